@@ -0,0 +1,205 @@
+package planitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/pivotal-cf/planitest/opsman"
+)
+
+// omBackend implements Backend by shelling out to the `om` CLI. It preserves
+// the behavior ProductService had before the native HTTP client existed.
+type omBackend struct {
+	cmdRunner    CommandRunner
+	authProvider opsman.AuthProvider
+}
+
+func (b *omBackend) args(args ...string) []string {
+	base := []string{"--skip-ssl-validation", "--target", os.Getenv("OM_URL")}
+	if b.authProvider != nil {
+		base = append(base, b.authProvider.CLIArgs()...)
+	}
+	return append(base, args...)
+}
+
+func (b *omBackend) RevertStagedChanges() error {
+	_, errOutput, err := b.cmdRunner.Run("om", b.args("revert-staged-changes")...)
+	if err != nil {
+		return fmt.Errorf("Unable to revert staged changes: %s: %s", err, errOutput)
+	}
+	return nil
+}
+
+func (b *omBackend) StageProduct(name, version string) error {
+	_, errOutput, err := b.cmdRunner.Run("om", b.args(
+		"stage-product",
+		"--product-name", name,
+		"--product-version", version,
+	)...)
+	if err != nil {
+		return fmt.Errorf("Unable to stage product %q, version %q: %s: %s", name, version, err, errOutput)
+	}
+	return nil
+}
+
+func (b *omBackend) ConfigureProduct(productName string, properties, network []byte) error {
+	_, errOutput, err := b.cmdRunner.Run("om", b.args(
+		"configure-product",
+		"--product-name", productName,
+		"--product-properties", string(properties),
+		"--product-network", string(network),
+	)...)
+	if err != nil {
+		return fmt.Errorf("Unable to configure product %q: %s: %s", productName, err, errOutput)
+	}
+	return nil
+}
+
+func (b *omBackend) stagedProductGUID(productName string) (string, error) {
+	response, errOutput, err := b.cmdRunner.Run("om", b.args("curl", "--path", "/api/v0/staged/products")...)
+	if err != nil {
+		return "", fmt.Errorf("Unable to retrieve staged products: %s: %s", err, errOutput)
+	}
+
+	var stagedProducts []StagedProductResponse
+	err = json.Unmarshal([]byte(response), &stagedProducts)
+	if err != nil {
+		return "", fmt.Errorf("Unable to retrieve staged products: %s", err)
+	}
+
+	var stagedTypes []string
+	for _, sp := range stagedProducts {
+		if sp.Type == productName {
+			return sp.GUID, nil
+		}
+		stagedTypes = append(stagedTypes, sp.Type)
+	}
+
+	return "", fmt.Errorf("Product %q has not been staged. Staged products: %q",
+		productName, strings.Join(stagedTypes, ", "))
+}
+
+func (b *omBackend) StagedManifest(productName string) (string, error) {
+	productGUID, err := b.stagedProductGUID(productName)
+	if err != nil {
+		return "", err
+	}
+
+	response, errOutput, err := b.cmdRunner.Run("om", b.args(
+		"curl",
+		"--path", fmt.Sprintf("/api/v0/staged/products/%s/manifest", productGUID),
+	)...)
+	if err != nil {
+		return "", fmt.Errorf("Unable to retrieve staged manifest for product guid %q: %s: %s", productGUID, err, errOutput)
+	}
+	var smr StagedManifestResponse
+	err = json.Unmarshal([]byte(response), &smr)
+	if err != nil {
+		return "", fmt.Errorf("Unable to retrieve staged manifest for product guid %q: %s", productGUID, err)
+	}
+	if len(smr.Errors.Messages) > 0 {
+		return "", fmt.Errorf("Unable to retrieve staged manifest for product guid %q: %s",
+			productGUID,
+			smr.Errors.Messages[0])
+	}
+
+	y, err := yaml.Marshal(smr.Manifest)
+	if err != nil {
+		return "", err // un-tested
+	}
+
+	return string(y), nil
+}
+
+func (b *omBackend) ProductProperties(productName string) (map[string]interface{}, error) {
+	productGUID, err := b.stagedProductGUID(productName)
+	if err != nil {
+		return nil, err
+	}
+
+	response, errOutput, err := b.cmdRunner.Run("om", b.args(
+		"curl",
+		"--path", fmt.Sprintf("/api/v0/staged/products/%s/properties", productGUID),
+	)...)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve properties for product guid %q: %s: %s", productGUID, err, errOutput)
+	}
+
+	var propertiesResponse struct {
+		Properties map[string]interface{} `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(response), &propertiesResponse); err != nil {
+		return nil, fmt.Errorf("Unable to retrieve properties for product guid %q: %s", productGUID, err)
+	}
+
+	return propertiesResponse.Properties, nil
+}
+
+// httpBackend implements Backend using the native opsman.Client.
+type httpBackend struct {
+	client *opsman.Client
+}
+
+func (b *httpBackend) RevertStagedChanges() error {
+	return b.client.RevertStagedChanges()
+}
+
+func (b *httpBackend) StageProduct(name, version string) error {
+	return b.client.StageProduct(name, version)
+}
+
+func (b *httpBackend) ConfigureProduct(productName string, properties, network []byte) error {
+	guid, err := b.findProductGUID(productName)
+	if err != nil {
+		return err
+	}
+	return b.client.ConfigureProduct(guid, json.RawMessage(properties), json.RawMessage(network))
+}
+
+func (b *httpBackend) StagedManifest(productName string) (string, error) {
+	guid, err := b.findProductGUID(productName)
+	if err != nil {
+		return "", err
+	}
+
+	manifest, err := b.client.StagedManifest(guid)
+	if err != nil {
+		return "", err
+	}
+
+	y, err := yaml.Marshal(manifest)
+	if err != nil {
+		return "", err // un-tested
+	}
+	return string(y), nil
+}
+
+func (b *httpBackend) ProductProperties(productName string) (map[string]interface{}, error) {
+	guid, err := b.findProductGUID(productName)
+	if err != nil {
+		return nil, err
+	}
+	return b.client.ProductProperties(guid)
+}
+
+func (b *httpBackend) findProductGUID(productName string) (string, error) {
+	stagedProducts, err := b.client.StagedProducts()
+	if err != nil {
+		return "", err
+	}
+
+	var stagedTypes []string
+	for _, sp := range stagedProducts {
+		if sp.Type == productName {
+			return sp.GUID, nil
+		}
+		stagedTypes = append(stagedTypes, sp.Type)
+	}
+
+	return "", fmt.Errorf("Product %q has not been staged. Staged products: %q",
+		productName, strings.Join(stagedTypes, ", "))
+}
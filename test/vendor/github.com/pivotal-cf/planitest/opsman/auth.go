@@ -0,0 +1,213 @@
+package opsman
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthProvider supplies the bearer token used to authenticate against the
+// Ops Manager API. Implementations are responsible for caching and
+// refreshing the token as needed.
+type AuthProvider interface {
+	// Token returns a valid access token, fetching or refreshing it if
+	// necessary.
+	Token() (string, error)
+
+	// CLIArgs returns the `om` flags carrying the equivalent credentials,
+	// for backends that still shell out to the CLI.
+	CLIArgs() []string
+}
+
+// tokenRefreshMargin is how far ahead of actual expiry a cached token is
+// considered stale, so a request never races a token expiring mid-flight.
+const tokenRefreshMargin = 30 * time.Second
+
+type tokenCache struct {
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func (c *tokenCache) get() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.accessToken == "" || time.Now().Add(tokenRefreshMargin).After(c.expiresAt) {
+		return "", false
+	}
+	return c.accessToken, true
+}
+
+func (c *tokenCache) set(token string, expiresIn int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accessToken = token
+	c.expiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
+}
+
+type uaaTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// fetchUAAToken exchanges the given grant for an access token against the
+// Ops Manager's embedded UAA.
+func fetchUAAToken(omURL string, form url.Values, clientID, clientSecret string) (uaaTokenResponse, error) {
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(omURL, "/")+"/uaa/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return uaaTokenResponse{}, err // un-tested
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(clientID, clientSecret)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return uaaTokenResponse{}, fmt.Errorf("unable to reach UAA: %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return uaaTokenResponse{}, err // un-tested
+	}
+
+	if resp.StatusCode >= 400 {
+		return uaaTokenResponse{}, fmt.Errorf("UAA returned %d: %s", resp.StatusCode, body)
+	}
+
+	var tr uaaTokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return uaaTokenResponse{}, fmt.Errorf("could not parse UAA token response: %s", err)
+	}
+	return tr, nil
+}
+
+// PasswordProvider authenticates with a UAA password grant, the same
+// credentials `om` accepts as OM_USERNAME/OM_PASSWORD.
+type PasswordProvider struct {
+	URL      string
+	Username string
+	Password string
+
+	cache tokenCache
+}
+
+func (p *PasswordProvider) Token() (string, error) {
+	if token, ok := p.cache.get(); ok {
+		return token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "password")
+	form.Set("username", p.Username)
+	form.Set("password", p.Password)
+	form.Set("response_type", "token")
+
+	tr, err := fetchUAAToken(p.URL, form, "opsman", "")
+	if err != nil {
+		return "", fmt.Errorf("unable to authenticate as %q: %s", p.Username, err)
+	}
+
+	p.cache.set(tr.AccessToken, tr.ExpiresIn)
+	return tr.AccessToken, nil
+}
+
+// CLIArgs returns no flags: `om` already picks OM_USERNAME/OM_PASSWORD up
+// from the process environment on its own, and passing them as flags
+// instead would put plaintext credentials in argv, visible to anything
+// that can list processes.
+func (p *PasswordProvider) CLIArgs() []string {
+	return nil
+}
+
+// ClientCredentialsProvider authenticates with a UAA client_credentials
+// grant, for service-to-service use (OM_CLIENT_ID/OM_CLIENT_SECRET).
+type ClientCredentialsProvider struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+
+	cache tokenCache
+}
+
+func (p *ClientCredentialsProvider) Token() (string, error) {
+	if token, ok := p.cache.get(); ok {
+		return token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	tr, err := fetchUAAToken(p.URL, form, p.ClientID, p.ClientSecret)
+	if err != nil {
+		return "", fmt.Errorf("unable to authenticate as client %q: %s", p.ClientID, err)
+	}
+
+	p.cache.set(tr.AccessToken, tr.ExpiresIn)
+	return tr.AccessToken, nil
+}
+
+// CLIArgs returns no flags: `om` already picks OM_CLIENT_ID/OM_CLIENT_SECRET
+// up from the process environment on its own, and passing them as flags
+// instead would put plaintext credentials in argv, visible to anything
+// that can list processes.
+func (p *ClientCredentialsProvider) CLIArgs() []string {
+	return nil
+}
+
+// StaticTokenProvider wraps a pre-obtained bearer token (OM_TOKEN). It never
+// refreshes; callers are responsible for supplying a token that outlives
+// the operation.
+type StaticTokenProvider struct {
+	AccessToken string
+}
+
+func (p *StaticTokenProvider) Token() (string, error) {
+	if p.AccessToken == "" {
+		return "", errors.New("no access token provided")
+	}
+	return p.AccessToken, nil
+}
+
+// CLIArgs returns no flags: `om` already picks OM_TOKEN up from the
+// process environment on its own, and passing it as a flag instead would
+// put a plaintext credential in argv, visible to anything that can list
+// processes.
+func (p *StaticTokenProvider) CLIArgs() []string {
+	return nil
+}
+
+// NewAuthProviderFromEnv picks an AuthProvider based on which of
+// OM_TOKEN, OM_CLIENT_ID/OM_CLIENT_SECRET, or OM_USERNAME/OM_PASSWORD are
+// set, in that order of precedence.
+func NewAuthProviderFromEnv(omURL string) (AuthProvider, error) {
+	if token := os.Getenv("OM_TOKEN"); token != "" {
+		return &StaticTokenProvider{AccessToken: token}, nil
+	}
+
+	clientID, clientSecret := os.Getenv("OM_CLIENT_ID"), os.Getenv("OM_CLIENT_SECRET")
+	if clientID != "" || clientSecret != "" {
+		if clientID == "" || clientSecret == "" {
+			return nil, errors.New("OM_CLIENT_ID and OM_CLIENT_SECRET must both be set")
+		}
+		return &ClientCredentialsProvider{URL: omURL, ClientID: clientID, ClientSecret: clientSecret}, nil
+	}
+
+	username, password := os.Getenv("OM_USERNAME"), os.Getenv("OM_PASSWORD")
+	if username != "" || password != "" {
+		if username == "" || password == "" {
+			return nil, errors.New("OM_USERNAME and OM_PASSWORD must both be set")
+		}
+		return &PasswordProvider{URL: omURL, Username: username, Password: password}, nil
+	}
+
+	return nil, errors.New("one of OM_TOKEN, OM_CLIENT_ID/OM_CLIENT_SECRET, or OM_USERNAME/OM_PASSWORD must be set")
+}
@@ -0,0 +1,122 @@
+package opsman
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func unsetAuthEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{"OM_TOKEN", "OM_CLIENT_ID", "OM_CLIENT_SECRET", "OM_USERNAME", "OM_PASSWORD"} {
+		old, had := os.LookupEnv(name)
+		os.Unsetenv(name)
+		t.Cleanup(func() {
+			if had {
+				os.Setenv(name, old)
+			}
+		})
+	}
+}
+
+func TestTokenCacheReturnsCachedTokenExpiringAfterRefreshMargin(t *testing.T) {
+	cache := tokenCache{}
+	cache.set("cached-token", int((tokenRefreshMargin + time.Minute).Seconds()))
+
+	token, ok := cache.get()
+	if !ok || token != "cached-token" {
+		t.Fatalf("expected the cached token to still be valid, got %q, %v", token, ok)
+	}
+}
+
+func TestTokenCacheTreatsTokenWithinRefreshMarginOfExpiryAsStale(t *testing.T) {
+	cache := tokenCache{}
+	cache.set("about-to-expire", int((tokenRefreshMargin - time.Second).Seconds()))
+
+	_, ok := cache.get()
+	if ok {
+		t.Fatal("expected a token expiring within the refresh margin to be treated as stale")
+	}
+}
+
+func TestTokenCacheTreatsUnsetTokenAsStale(t *testing.T) {
+	cache := tokenCache{}
+
+	_, ok := cache.get()
+	if ok {
+		t.Fatal("expected an empty cache to report no valid token")
+	}
+}
+
+func TestNewAuthProviderFromEnvPrefersTokenOverClientCredentialsAndPassword(t *testing.T) {
+	unsetAuthEnv(t)
+	os.Setenv("OM_TOKEN", "some-token")
+	os.Setenv("OM_CLIENT_ID", "some-client-id")
+	os.Setenv("OM_CLIENT_SECRET", "some-client-secret")
+	os.Setenv("OM_USERNAME", "some-username")
+	os.Setenv("OM_PASSWORD", "some-password")
+
+	provider, err := NewAuthProviderFromEnv("https://opsman.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := provider.(*StaticTokenProvider); !ok {
+		t.Fatalf("expected a StaticTokenProvider, got %T", provider)
+	}
+}
+
+func TestNewAuthProviderFromEnvPrefersClientCredentialsOverPassword(t *testing.T) {
+	unsetAuthEnv(t)
+	os.Setenv("OM_CLIENT_ID", "some-client-id")
+	os.Setenv("OM_CLIENT_SECRET", "some-client-secret")
+	os.Setenv("OM_USERNAME", "some-username")
+	os.Setenv("OM_PASSWORD", "some-password")
+
+	provider, err := NewAuthProviderFromEnv("https://opsman.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := provider.(*ClientCredentialsProvider); !ok {
+		t.Fatalf("expected a ClientCredentialsProvider, got %T", provider)
+	}
+}
+
+func TestNewAuthProviderFromEnvFallsBackToPassword(t *testing.T) {
+	unsetAuthEnv(t)
+	os.Setenv("OM_USERNAME", "some-username")
+	os.Setenv("OM_PASSWORD", "some-password")
+
+	provider, err := NewAuthProviderFromEnv("https://opsman.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := provider.(*PasswordProvider); !ok {
+		t.Fatalf("expected a PasswordProvider, got %T", provider)
+	}
+}
+
+func TestNewAuthProviderFromEnvErrorsOnPartialClientCredentials(t *testing.T) {
+	unsetAuthEnv(t)
+	os.Setenv("OM_CLIENT_ID", "some-client-id")
+
+	if _, err := NewAuthProviderFromEnv("https://opsman.example.com"); err == nil {
+		t.Fatal("expected an error when only OM_CLIENT_ID is set")
+	}
+}
+
+func TestNewAuthProviderFromEnvErrorsOnPartialPassword(t *testing.T) {
+	unsetAuthEnv(t)
+	os.Setenv("OM_USERNAME", "some-username")
+
+	if _, err := NewAuthProviderFromEnv("https://opsman.example.com"); err == nil {
+		t.Fatal("expected an error when only OM_USERNAME is set")
+	}
+}
+
+func TestNewAuthProviderFromEnvErrorsWhenNothingIsSet(t *testing.T) {
+	unsetAuthEnv(t)
+
+	if _, err := NewAuthProviderFromEnv("https://opsman.example.com"); err == nil {
+		t.Fatal("expected an error when no credentials are set")
+	}
+}
@@ -0,0 +1,230 @@
+// Package opsman provides a native HTTP client for the Ops Manager API. It
+// exists as an alternative to shelling out to the `om` CLI: callers get a
+// typed request/response shape and real Go errors instead of stderr blobs,
+// and repeated calls no longer pay for a process fork and fresh TLS
+// handshake every time.
+package opsman
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultRetries = 3
+const defaultRetryWait = time.Second
+
+// Config configures a Client.
+type Config struct {
+	URL string
+
+	// RoundTripper is used to make requests. Defaults to
+	// http.DefaultTransport if nil, but is the extension point callers use
+	// to inject auth, logging, or test doubles.
+	RoundTripper http.RoundTripper
+
+	// Retries is the number of times a request is retried on a transport
+	// error or a 5xx response before giving up. Defaults to 3.
+	Retries int
+
+	// AuthProvider supplies the bearer token attached to every request. If
+	// nil, requests are sent unauthenticated.
+	AuthProvider AuthProvider
+}
+
+// Client talks directly to the Ops Manager REST API.
+type Client struct {
+	url          string
+	httpClient   *http.Client
+	retries      int
+	authProvider AuthProvider
+}
+
+// NewClient builds a Client from the given Config.
+func NewClient(config Config) *Client {
+	transport := config.RoundTripper
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	retries := config.Retries
+	if retries <= 0 {
+		retries = defaultRetries
+	}
+
+	return &Client{
+		url:          strings.TrimRight(config.URL, "/"),
+		httpClient:   &http.Client{Transport: transport},
+		retries:      retries,
+		authProvider: config.AuthProvider,
+	}
+}
+
+// StagedProduct is an entry in the /api/v0/staged/products response.
+type StagedProduct struct {
+	GUID string `json:"guid"`
+	Type string `json:"type"`
+}
+
+// StagedProducts returns every product currently staged on the Ops Manager.
+func (c *Client) StagedProducts() ([]StagedProduct, error) {
+	var products []StagedProduct
+	if err := c.do(http.MethodGet, "/api/v0/staged/products", nil, &products); err != nil {
+		return nil, fmt.Errorf("unable to retrieve staged products: %s", err)
+	}
+	return products, nil
+}
+
+type stageProductRequest struct {
+	Name    string `json:"name"`
+	Version string `json:"product_version"`
+}
+
+// StageProduct stages the given product name/version pair.
+func (c *Client) StageProduct(name, version string) error {
+	body, err := json.Marshal(stageProductRequest{Name: name, Version: version})
+	if err != nil {
+		return err // un-tested
+	}
+
+	if err := c.do(http.MethodPost, "/api/v0/staged/products", bytes.NewReader(body), nil); err != nil {
+		return fmt.Errorf("unable to stage product %q, version %q: %s", name, version, err)
+	}
+	return nil
+}
+
+type configureProductRequest struct {
+	Properties json.RawMessage `json:"properties"`
+	Network    json.RawMessage `json:"network"`
+}
+
+// ConfigureProduct sets the properties and network configuration of the
+// staged product identified by guid.
+func (c *Client) ConfigureProduct(guid string, properties, network json.RawMessage) error {
+	body, err := json.Marshal(configureProductRequest{Properties: properties, Network: network})
+	if err != nil {
+		return err // un-tested
+	}
+
+	path := fmt.Sprintf("/api/v0/staged/products/%s/properties", guid)
+	if err := c.do(http.MethodPut, path, bytes.NewReader(body), nil); err != nil {
+		return fmt.Errorf("unable to configure product guid %q: %s", guid, err)
+	}
+	return nil
+}
+
+// ProductProperties returns the raw property metadata and current values for
+// the staged product identified by guid.
+func (c *Client) ProductProperties(guid string) (map[string]interface{}, error) {
+	var response struct {
+		Properties map[string]interface{} `json:"properties"`
+	}
+	path := fmt.Sprintf("/api/v0/staged/products/%s/properties", guid)
+	if err := c.do(http.MethodGet, path, nil, &response); err != nil {
+		return nil, fmt.Errorf("unable to retrieve properties for product guid %q: %s", guid, err)
+	}
+	return response.Properties, nil
+}
+
+// NetworksAndAZs returns the network/AZ configuration for the staged product
+// identified by guid.
+func (c *Client) NetworksAndAZs(guid string) (map[string]interface{}, error) {
+	var response struct {
+		NetworksAndAZs map[string]interface{} `json:"networks_and_azs"`
+	}
+	path := fmt.Sprintf("/api/v0/staged/products/%s/networks_and_azs", guid)
+	if err := c.do(http.MethodGet, path, nil, &response); err != nil {
+		return nil, fmt.Errorf("unable to retrieve networks and azs for product guid %q: %s", guid, err)
+	}
+	return response.NetworksAndAZs, nil
+}
+
+// RevertStagedChanges discards any uncommitted staged changes.
+func (c *Client) RevertStagedChanges() error {
+	if err := c.do(http.MethodDelete, "/api/v0/staged/pending_changes", nil, nil); err != nil {
+		return fmt.Errorf("unable to revert staged changes: %s", err)
+	}
+	return nil
+}
+
+type stagedManifestResponse struct {
+	Manifest map[string]interface{} `json:"manifest"`
+}
+
+// StagedManifest returns the rendered manifest for the staged product
+// identified by guid.
+func (c *Client) StagedManifest(guid string) (map[string]interface{}, error) {
+	var response stagedManifestResponse
+	path := fmt.Sprintf("/api/v0/staged/products/%s/manifest", guid)
+	if err := c.do(http.MethodGet, path, nil, &response); err != nil {
+		return nil, fmt.Errorf("unable to retrieve staged manifest for product guid %q: %s", guid, err)
+	}
+	return response.Manifest, nil
+}
+
+// do executes an HTTP request against the Ops Manager API, retrying on
+// transport errors and 5xx responses, and decodes a JSON response body into
+// out when non-nil.
+func (c *Client) do(method, path string, body *bytes.Reader, out interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		reqBody, _ = ioutil.ReadAll(body)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(defaultRetryWait)
+		}
+
+		req, err := http.NewRequest(method, c.url+path, bytes.NewReader(reqBody))
+		if err != nil {
+			return err // un-tested
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		if c.authProvider != nil {
+			token, err := c.authProvider.Token()
+			if err != nil {
+				return fmt.Errorf("unable to authenticate: %s", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode >= 500 {
+			lastErr = fmt.Errorf("%s %s: %d: %s", method, path, resp.StatusCode, respBody)
+			continue
+		}
+
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("%s %s: %d: %s", method, path, resp.StatusCode, respBody)
+		}
+
+		if out != nil && len(respBody) > 0 {
+			if err := json.Unmarshal(respBody, out); err != nil {
+				return fmt.Errorf("%s %s: could not parse response: %s", method, path, err)
+			}
+		}
+
+		return nil
+	}
+
+	return lastErr
+}
@@ -0,0 +1,134 @@
+package opsman
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeRoundTripper returns the responses in order, one per call, and
+// remembers how many times it was called.
+type fakeRoundTripper struct {
+	responses []*http.Response
+	errs      []error
+	calls     int
+}
+
+func (f *fakeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	i := f.calls
+	f.calls++
+
+	if i < len(f.errs) && f.errs[i] != nil {
+		return nil, f.errs[i]
+	}
+	return f.responses[i], nil
+}
+
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestClientRetriesOn5xxThenSucceeds(t *testing.T) {
+	transport := &fakeRoundTripper{
+		responses: []*http.Response{
+			jsonResponse(http.StatusServiceUnavailable, "try again"),
+			jsonResponse(http.StatusServiceUnavailable, "try again"),
+			jsonResponse(http.StatusOK, `[{"guid":"p1","type":"p-bosh"}]`),
+		},
+	}
+	client := NewClient(Config{URL: "https://opsman.example.com", RoundTripper: transport, Retries: 3})
+
+	products, err := client.StagedProducts()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if transport.calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", transport.calls)
+	}
+	if len(products) != 1 || products[0].GUID != "p1" {
+		t.Fatalf("expected the eventual success response to be decoded, got %+v", products)
+	}
+}
+
+func TestClientGivesUpAfterExhaustingRetries(t *testing.T) {
+	transport := &fakeRoundTripper{
+		responses: []*http.Response{
+			jsonResponse(http.StatusServiceUnavailable, "down"),
+			jsonResponse(http.StatusServiceUnavailable, "down"),
+		},
+	}
+	client := NewClient(Config{URL: "https://opsman.example.com", RoundTripper: transport, Retries: 1})
+
+	_, err := client.StagedProducts()
+	if err == nil {
+		t.Fatal("expected an error once retries are exhausted, got nil")
+	}
+	if transport.calls != 2 {
+		t.Fatalf("expected 2 attempts (1 initial + 1 retry), got %d", transport.calls)
+	}
+}
+
+func TestClientFailsFastOn4xxWithoutRetrying(t *testing.T) {
+	transport := &fakeRoundTripper{
+		responses: []*http.Response{
+			jsonResponse(http.StatusBadRequest, `{"errors":{"base":["bad request"]}}`),
+		},
+	}
+	client := NewClient(Config{URL: "https://opsman.example.com", RoundTripper: transport, Retries: 3})
+
+	_, err := client.StagedProducts()
+	if err == nil {
+		t.Fatal("expected an error for a 4xx response, got nil")
+	}
+	if transport.calls != 1 {
+		t.Fatalf("expected no retries on a 4xx response, got %d attempts", transport.calls)
+	}
+	if !strings.Contains(err.Error(), "bad request") {
+		t.Fatalf("expected the response body to surface in the error, got: %s", err)
+	}
+}
+
+type staticTokenAuthProvider struct {
+	token string
+}
+
+func (p *staticTokenAuthProvider) Token() (string, error) { return p.token, nil }
+func (p *staticTokenAuthProvider) CLIArgs() []string      { return nil }
+
+func TestClientAttachesBearerTokenFromAuthProvider(t *testing.T) {
+	var gotAuthHeader string
+	transport := &recordingRoundTripper{
+		response: jsonResponse(http.StatusOK, `[]`),
+		onRequest: func(req *http.Request) {
+			gotAuthHeader = req.Header.Get("Authorization")
+		},
+	}
+	client := NewClient(Config{
+		URL:          "https://opsman.example.com",
+		RoundTripper: transport,
+		AuthProvider: &staticTokenAuthProvider{token: "some-token"},
+	})
+
+	if _, err := client.StagedProducts(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if gotAuthHeader != "Bearer some-token" {
+		t.Fatalf("expected the bearer token from the auth provider, got %q", gotAuthHeader)
+	}
+}
+
+type recordingRoundTripper struct {
+	response  *http.Response
+	onRequest func(*http.Request)
+}
+
+func (r *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.onRequest != nil {
+		r.onRequest(req)
+	}
+	return r.response, nil
+}
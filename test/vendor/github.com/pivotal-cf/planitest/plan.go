@@ -0,0 +1,215 @@
+package planitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// PropertyChange describes how a single property's value would change if
+// a ConfigPlan were applied. Secret values are redacted in Old/New.
+type PropertyChange struct {
+	Key    string
+	Action string // "add", "remove", "change", or "unchanged"
+	Old    interface{}
+	New    interface{}
+}
+
+// ConfigPlan is the result of ProductService.Plan: what Configure would
+// change if called with the same arguments, computed without having
+// applied it. Call Apply to actually invoke configure-product.
+type ConfigPlan struct {
+	service    *ProductService
+	changes    []PropertyChange
+	properties []byte
+	network    []byte
+}
+
+// Changes returns every property that would be added, removed, or changed
+// by Apply, in ascending key order. Unchanged properties are omitted.
+func (c *ConfigPlan) Changes() []PropertyChange {
+	var changes []PropertyChange
+	for _, change := range c.changes {
+		if change.Action != "unchanged" {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// Empty reports whether applying this plan would change anything.
+func (c *ConfigPlan) Empty() bool {
+	return len(c.Changes()) == 0
+}
+
+func (c *ConfigPlan) String() string {
+	changes := c.Changes()
+	if len(changes) == 0 {
+		return fmt.Sprintf("%s: no changes", c.service.config.Name)
+	}
+
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		switch change.Action {
+		case "add":
+			lines = append(lines, fmt.Sprintf("+ %s: %v", change.Key, change.New))
+		case "remove":
+			lines = append(lines, fmt.Sprintf("- %s: %v", change.Key, change.Old))
+		default:
+			lines = append(lines, fmt.Sprintf("~ %s: %v -> %v", change.Key, change.Old, change.New))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Apply invokes configure-product with the properties this plan computed,
+// without re-staging the product or recomputing the diff.
+func (c *ConfigPlan) Apply() error {
+	return c.service.backend.ConfigureProduct(c.service.config.Name, c.properties, c.network)
+}
+
+// Plan stages the product (if it isn't already staged) and computes what
+// Configure(additionalProperties) would change on the server, without
+// invoking configure-product. Call Apply on the returned ConfigPlan to
+// apply it once a human or CI has reviewed the diff.
+func (p *ProductService) Plan(additionalProperties map[string]interface{}) (*ConfigPlan, error) {
+	minimalProperties, err := loadConfigFile(p.config.PropertiesFile, p.config.TemplateFuncs)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to plan product %q: could not parse properties file %q: %s", p.config.Name, p.config.PropertiesFile, err)
+	}
+
+	network, err := loadConfigFile(p.config.NetworkConfigFile, p.config.TemplateFuncs)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to plan product %q: could not parse network config file %q: %s", p.config.Name, p.config.NetworkConfigFile, err)
+	}
+
+	combinedProperties := mergeProperties(minimalProperties, additionalProperties)
+
+	propertiesJSON, err := json.Marshal(combinedProperties)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to plan product %q: %s", p.config.Name, err) // un-tested
+	}
+
+	networkJSON, err := json.Marshal(network)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to plan product %q: %s", p.config.Name, err) // un-tested
+	}
+
+	if err := p.backend.StageProduct(p.config.Name, p.config.Version); err != nil {
+		return nil, err
+	}
+
+	schema, err := p.loadPropertySchema()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to plan product %q: could not load property schema: %s", p.config.Name, err)
+	}
+
+	if err := validateProperties(combinedProperties, schema); err != nil {
+		return nil, fmt.Errorf("Unable to plan product %q: %s", p.config.Name, err)
+	}
+
+	current, err := p.backend.ProductProperties(p.config.Name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to plan product %q: could not read current configuration: %s", p.config.Name, err)
+	}
+
+	return &ConfigPlan{
+		service:    p,
+		changes:    diffProperties(current, combinedProperties, schema),
+		properties: propertiesJSON,
+		network:    networkJSON,
+	}, nil
+}
+
+// diffProperties compares the current, server-side properties (as
+// returned by the /properties endpoint) against desired (the combined,
+// `om`-shaped properties map Configure would send), redacting any key
+// schema marks as a secret type.
+func diffProperties(current, desired map[string]interface{}, schema []propertySchema) []PropertyChange {
+	secretKeys := make(map[string]bool, len(schema))
+	for _, s := range schema {
+		if isSecretType(s.Type) {
+			secretKeys[s.Name] = true
+		}
+	}
+
+	keys := make(map[string]bool, len(current)+len(desired))
+	for k := range current {
+		keys[k] = true
+	}
+	for k := range desired {
+		keys[k] = true
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for k := range keys {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Strings(sortedKeys)
+
+	changes := make([]PropertyChange, 0, len(sortedKeys))
+	for _, key := range sortedKeys {
+		oldValue, hadOld := extractPropertyValue(current[key])
+		newValue, hadNew := extractPropertyValue(desired[key])
+
+		if secretKeys[key] {
+			if hadOld {
+				oldValue = "(redacted)"
+			}
+			if hadNew {
+				newValue = "(redacted)"
+			}
+		}
+
+		change := PropertyChange{Key: key, Old: oldValue, New: newValue}
+		switch {
+		case !hadOld && hadNew:
+			change.Action = "add"
+		case hadOld && !hadNew:
+			change.Action = "remove"
+		case secretKeys[key]:
+			// Secrets are redacted before they reach us, so we can't tell
+			// whether the value actually changed; always surface them for
+			// explicit review.
+			change.Action = "change"
+		case !reflect.DeepEqual(oldValue, newValue):
+			change.Action = "change"
+		default:
+			change.Action = "unchanged"
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// extractPropertyValue unwraps the {value: ...} shape both the /properties
+// endpoint and mergeProperties use. The second return is false if key was
+// absent entirely.
+func extractPropertyValue(raw interface{}) (interface{}, bool) {
+	if raw == nil {
+		return nil, false
+	}
+
+	wrapper, ok := raw.(map[string]interface{})
+	if !ok {
+		return raw, true
+	}
+
+	value, ok := wrapper["value"]
+	if !ok {
+		return nil, false
+	}
+	return value, true
+}
+
+func isSecretType(propType string) bool {
+	switch propType {
+	case "secret", "rsa_cert_credentials", "rsa_pkey_credentials", "salted_credentials", "simple_credentials":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package planitest
+
+import (
+	"strings"
+	"testing"
+)
+
+func findChange(t *testing.T, changes []PropertyChange, key string) PropertyChange {
+	t.Helper()
+	for _, c := range changes {
+		if c.Key == key {
+			return c
+		}
+	}
+	t.Fatalf("expected a change for %q, got: %+v", key, changes)
+	return PropertyChange{}
+}
+
+func TestDiffPropertiesAddRemoveChange(t *testing.T) {
+	current := map[string]interface{}{
+		".properties.unchanged": map[string]interface{}{"value": "same"},
+		".properties.changed":   map[string]interface{}{"value": "old"},
+		".properties.removed":   map[string]interface{}{"value": "gone"},
+	}
+	desired := map[string]interface{}{
+		".properties.unchanged": map[string]interface{}{"value": "same"},
+		".properties.changed":   map[string]interface{}{"value": "new"},
+		".properties.added":     map[string]interface{}{"value": "fresh"},
+	}
+
+	changes := diffProperties(current, desired, nil)
+
+	var nonUnchanged []PropertyChange
+	for _, c := range changes {
+		if c.Action != "unchanged" {
+			nonUnchanged = append(nonUnchanged, c)
+		}
+	}
+	if len(nonUnchanged) != 3 {
+		t.Fatalf("expected 3 changes (add/remove/change), got %d: %+v", len(nonUnchanged), nonUnchanged)
+	}
+
+	added := findChange(t, nonUnchanged, ".properties.added")
+	if added.Action != "add" || added.New != "fresh" {
+		t.Fatalf("expected an add of %q, got %+v", "fresh", added)
+	}
+
+	removed := findChange(t, nonUnchanged, ".properties.removed")
+	if removed.Action != "remove" || removed.Old != "gone" {
+		t.Fatalf("expected a remove of %q, got %+v", "gone", removed)
+	}
+
+	changed := findChange(t, nonUnchanged, ".properties.changed")
+	if changed.Action != "change" || changed.Old != "old" || changed.New != "new" {
+		t.Fatalf("expected a change from %q to %q, got %+v", "old", "new", changed)
+	}
+}
+
+func TestDiffPropertiesRedactsSecretsFromMetadataSchema(t *testing.T) {
+	path := writeTempFile(t, testMetadataYAML)
+
+	schema, err := loadSchemaFromMetadataFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	current := map[string]interface{}{
+		".properties.some_secret": map[string]interface{}{"value": map[string]interface{}{"secret": "old-secret-value"}},
+	}
+	desired := map[string]interface{}{
+		".properties.some_secret": map[string]interface{}{"value": map[string]interface{}{"secret": "new-secret-value"}},
+	}
+
+	changes := diffProperties(current, desired, schema)
+	secretChange := findChange(t, changes, ".properties.some_secret")
+
+	if secretChange.Action != "change" {
+		t.Fatalf("expected the secret to be flagged as changed, got action %q", secretChange.Action)
+	}
+
+	for _, value := range []interface{}{secretChange.Old, secretChange.New} {
+		s, ok := value.(string)
+		if !ok || s != "(redacted)" {
+			t.Fatalf("expected secret values to be redacted in the diff output, got %+v", secretChange)
+		}
+		if strings.Contains(s, "secret-value") {
+			t.Fatalf("secret value leaked into plan output: %+v", secretChange)
+		}
+	}
+}
@@ -4,11 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"strings"
 
-	yaml "gopkg.in/yaml.v2"
+	"github.com/pivotal-cf/planitest/opsman"
 )
 
 //go:generate counterfeiter -o ./fakes/command_runner.go --fake-name CommandRunner . CommandRunner
@@ -16,16 +14,43 @@ type CommandRunner interface {
 	Run(string, ...string) (string, string, error)
 }
 
+// Backend is the transport ProductService uses to talk to Ops Manager. The
+// native HTTP client (backed by opsman.Client) is the default; the `om` CLI
+// backend is kept for callers who still depend on CommandRunner.
+//
+//go:generate counterfeiter -o ./fakes/backend.go --fake-name Backend . Backend
+type Backend interface {
+	RevertStagedChanges() error
+	StageProduct(name, version string) error
+	ConfigureProduct(productName string, properties, network []byte) error
+	StagedManifest(productName string) (string, error)
+	ProductProperties(productName string) (map[string]interface{}, error)
+}
+
 type ProductConfig struct {
 	Name              string
 	Version           string
 	PropertiesFile    string
 	NetworkConfigFile string
+
+	// TemplateFuncs are made available, alongside the built-in `env` and
+	// `file` functions, when rendering PropertiesFile and
+	// NetworkConfigFile as Go text/template templates. This lets a single
+	// properties file be reused across environments, e.g. by supplying a
+	// `vault` lookup function here instead of pre-processing the file.
+	TemplateFuncs map[string]interface{}
+
+	// MetadataFile, if set, points at the tile's metadata/*.yml and is
+	// used to validate properties before configure-product is invoked. If
+	// unset, the schema is instead fetched from the staged product's
+	// /properties endpoint.
+	MetadataFile string
 }
 
 type ProductService struct {
 	config    ProductConfig
 	cmdRunner CommandRunner
+	backend   Backend
 }
 
 type StagedProductResponse struct {
@@ -43,11 +68,11 @@ type OMError struct {
 	Messages []string `json:"base"`
 }
 
+// NewProductService builds a ProductService backed by the native Ops
+// Manager HTTP client. This replaces the `om` CLI shell-out as the default
+// transport: it avoids forking a process per call and surfaces typed errors
+// instead of stderr strings.
 func NewProductService(config ProductConfig) (*ProductService, error) {
-	return NewProductServiceWithRunner(config, NewExecutor())
-}
-
-func NewProductServiceWithRunner(config ProductConfig, cmdRunner CommandRunner) (*ProductService, error) {
 	err := validateEnvironmentVariables()
 	if err != nil {
 		return nil, err
@@ -58,136 +83,132 @@ func NewProductServiceWithRunner(config ProductConfig, cmdRunner CommandRunner)
 		return nil, err
 	}
 
-	return &ProductService{config: config, cmdRunner: cmdRunner}, nil
-}
+	authProvider, err := opsman.NewAuthProviderFromEnv(os.Getenv("OM_URL"))
+	if err != nil {
+		return nil, err
+	}
 
-func (p *ProductService) Configure(additionalProperties map[string]interface{}) error {
+	client := opsman.NewClient(opsman.Config{URL: os.Getenv("OM_URL"), AuthProvider: authProvider})
 
-	propertiesJSON, err := ioutil.ReadFile(p.config.PropertiesFile)
+	// Manifest still shells out to `om` for its own operations (e.g.
+	// apply-changes), so it needs a real CommandRunner even though
+	// ProductService itself now talks to Ops Manager over HTTP.
+	return &ProductService{config: config, cmdRunner: NewExecutor(), backend: &httpBackend{client: client}}, nil
+}
+
+// NewProductServiceWithRunner builds a ProductService that shells out to the
+// `om` CLI via cmdRunner, for callers who aren't ready to move to the native
+// HTTP client.
+func NewProductServiceWithRunner(config ProductConfig, cmdRunner CommandRunner) (*ProductService, error) {
+	err := validateEnvironmentVariables()
 	if err != nil {
-		return fmt.Errorf("Unable to configure product %q: %s", p.config.Name, err)
+		return nil, err
 	}
 
-	var minimalProperties map[string]interface{}
-	err = json.Unmarshal(propertiesJSON, &minimalProperties)
+	err = validateProductConfig(config)
 	if err != nil {
-		return fmt.Errorf("Unable to configure product %q: could not parse properties file %q: %s", p.config.Name, p.config.PropertiesFile, err)
+		return nil, err
 	}
 
-	networkJSON, err := ioutil.ReadFile(p.config.NetworkConfigFile)
+	authProvider, err := opsman.NewAuthProviderFromEnv(os.Getenv("OM_URL"))
 	if err != nil {
-		return fmt.Errorf("Unable to configure product %q: %s", p.config.Name, err)
+		return nil, err
 	}
 
-	combinedProperties := mergeProperties(minimalProperties, additionalProperties)
+	return &ProductService{config: config, cmdRunner: cmdRunner, backend: &omBackend{cmdRunner: cmdRunner, authProvider: authProvider}}, nil
+}
 
-	propertiesJSON, err = json.Marshal(combinedProperties)
+// NewProductServiceWithBackend builds a ProductService against an arbitrary
+// Backend, e.g. for tests or for ProductSuite.AddProductWithBackend.
+func NewProductServiceWithBackend(config ProductConfig, backend Backend) (*ProductService, error) {
+	err := validateProductConfig(config)
 	if err != nil {
-		return fmt.Errorf("Unable to configure product %q: %s", p.config.Name, err) // un-tested
+		return nil, err
 	}
 
-	_, errOutput, err := p.cmdRunner.Run(
-		"om",
-		"--skip-ssl-validation",
-		"--target", os.Getenv("OM_URL"),
-		"revert-staged-changes",
-	)
+	// Manifest still shells out to `om` for its own operations, so it needs
+	// a real CommandRunner even when backend isn't an omBackend.
+	return &ProductService{config: config, cmdRunner: NewExecutor(), backend: backend}, nil
+}
 
-	if err != nil {
-		return fmt.Errorf("Unable to revert staged changes: %s: %s", err, errOutput)
+// Configure reverts any staged changes and then stages and configures this
+// product in isolation. Callers orchestrating several products as one
+// foundation should use ProductSuite instead, which reverts staged changes
+// once for the whole suite rather than once per product.
+func (p *ProductService) Configure(additionalProperties map[string]interface{}) error {
+	if err := p.backend.RevertStagedChanges(); err != nil {
+		return err
 	}
 
-	_, errOutput, err = p.cmdRunner.Run(
-		"om",
-		"--skip-ssl-validation",
-		"--target", os.Getenv("OM_URL"),
-		"stage-product",
-		"--product-name", p.config.Name,
-		"--product-version", p.config.Version,
-	)
+	return p.configureWithoutRevert(additionalProperties)
+}
 
+func (p *ProductService) configureWithoutRevert(additionalProperties map[string]interface{}) error {
+	minimalProperties, err := loadConfigFile(p.config.PropertiesFile, p.config.TemplateFuncs)
 	if err != nil {
-		return fmt.Errorf("Unable to stage product %q, version %q: %s: %s",
-			p.config.Name, p.config.Version, err, errOutput)
+		return fmt.Errorf("Unable to configure product %q: could not parse properties file %q: %s", p.config.Name, p.config.PropertiesFile, err)
 	}
 
-	_, errOutput, err = p.cmdRunner.Run(
-		"om",
-		"--skip-ssl-validation",
-		"--target", os.Getenv("OM_URL"),
-		"configure-product",
-		"--product-name", p.config.Name,
-		"--product-properties", string(propertiesJSON),
-		"--product-network", string(networkJSON),
-	)
-
+	network, err := loadConfigFile(p.config.NetworkConfigFile, p.config.TemplateFuncs)
 	if err != nil {
-		return fmt.Errorf("Unable to configure product %q: %s: %s", p.config.Name, err, errOutput)
+		return fmt.Errorf("Unable to configure product %q: could not parse network config file %q: %s", p.config.Name, p.config.NetworkConfigFile, err)
 	}
 
-	return nil
-}
+	combinedProperties := mergeProperties(minimalProperties, additionalProperties)
 
-func (p *ProductService) RenderManifest() (Manifest, error) {
-	response, errOutput, err := p.cmdRunner.Run(
-		"om",
-		"--skip-ssl-validation",
-		"--target", os.Getenv("OM_URL"),
-		"curl",
-		"--path", "/api/v0/staged/products",
-	)
+	propertiesJSON, err := json.Marshal(combinedProperties)
 	if err != nil {
-		return Manifest{}, fmt.Errorf("Unable to retrieve staged products: %s: %s", err, errOutput)
+		return fmt.Errorf("Unable to configure product %q: %s", p.config.Name, err) // un-tested
 	}
 
-	var stagedProducts []StagedProductResponse
-	err = json.Unmarshal([]byte(response), &stagedProducts)
+	networkJSON, err := json.Marshal(network)
 	if err != nil {
-		return Manifest{}, fmt.Errorf("Unable to retrieve staged products: %s", err)
+		return fmt.Errorf("Unable to configure product %q: %s", p.config.Name, err) // un-tested
 	}
 
-	var productGUID string
-	var stagedTypes []string
-	for _, sp := range stagedProducts {
-		if sp.Type == p.config.Name {
-			productGUID = sp.GUID
-			break
-		} else {
-			stagedTypes = append(stagedTypes, sp.Type)
-		}
-	}
-	if productGUID == "" {
-		return Manifest{}, fmt.Errorf("Product %q has not been staged. Staged products: %q",
-			p.config.Name, strings.Join(stagedTypes, ", "))
+	if err := p.backend.StageProduct(p.config.Name, p.config.Version); err != nil {
+		return err
 	}
 
-	response, errOutput, err = p.cmdRunner.Run(
-		"om",
-		"--skip-ssl-validation",
-		"--target", os.Getenv("OM_URL"),
-		"curl",
-		"--path", fmt.Sprintf("/api/v0/staged/products/%s/manifest", productGUID),
-	)
+	schema, err := p.loadPropertySchema()
 	if err != nil {
-		return Manifest{}, fmt.Errorf("Unable to retrieve staged manifest for product guid %q: %s: %s", productGUID, err, errOutput)
+		return fmt.Errorf("Unable to configure product %q: could not load property schema: %s", p.config.Name, err)
 	}
-	var smr StagedManifestResponse
-	err = json.Unmarshal([]byte(response), &smr)
-	if err != nil {
-		return Manifest{}, fmt.Errorf("Unable to retrieve staged manifest for product guid %q: %s", productGUID, err)
+
+	if err := validateProperties(combinedProperties, schema); err != nil {
+		return fmt.Errorf("Unable to configure product %q: %s", p.config.Name, err)
 	}
-	if len(smr.Errors.Messages) > 0 {
-		return Manifest{}, fmt.Errorf("Unable to retrieve staged manifest for product guid %q: %s",
-			productGUID,
-			smr.Errors.Messages[0])
+
+	if err := p.backend.ConfigureProduct(p.config.Name, propertiesJSON, networkJSON); err != nil {
+		return err
 	}
 
-	y, err := yaml.Marshal(smr.Manifest)
+	return nil
+}
+
+// loadPropertySchema loads the property schema used to validate
+// combinedProperties before configure-product is invoked, preferring
+// ProductConfig.MetadataFile when set and otherwise fetching it from the
+// already-staged product.
+func (p *ProductService) loadPropertySchema() ([]propertySchema, error) {
+	if p.config.MetadataFile != "" {
+		return loadSchemaFromMetadataFile(p.config.MetadataFile)
+	}
+
+	properties, err := p.backend.ProductProperties(p.config.Name)
+	if err != nil {
+		return nil, err
+	}
+	return loadSchemaFromAPIProperties(properties), nil
+}
+
+func (p *ProductService) RenderManifest() (Manifest, error) {
+	y, err := p.backend.StagedManifest(p.config.Name)
 	if err != nil {
-		return Manifest{}, err // un-tested
+		return Manifest{}, err
 	}
 
-	return NewManifest(string(y), p.cmdRunner), nil
+	return NewManifest(y, p.cmdRunner), nil
 }
 
 func mergeProperties(minimalProperties, additionalProperties map[string]interface{}) map[string]interface{} {
@@ -205,13 +226,14 @@ func mergeProperties(minimalProperties, additionalProperties map[string]interfac
 }
 
 func validateEnvironmentVariables() error {
-	requiredEnvVars := []string{"OM_USERNAME", "OM_PASSWORD", "OM_URL"}
-	for _, envVar := range requiredEnvVars {
-		value := os.Getenv(envVar)
-		if value == "" {
-			return fmt.Errorf("Environment variable %s must be set", envVar)
-		}
+	if os.Getenv("OM_URL") == "" {
+		return errors.New("Environment variable OM_URL must be set")
 	}
+
+	if _, err := opsman.NewAuthProviderFromEnv(os.Getenv("OM_URL")); err != nil {
+		return fmt.Errorf("Unable to determine Ops Manager credentials: %s", err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,129 @@
+package planitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// defaultTemplateFuncs are always available when rendering PropertiesFile
+// and NetworkConfigFile, even when ProductConfig.TemplateFuncs doesn't
+// override them.
+func defaultTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"env": os.Getenv,
+		"file": func(path string) (string, error) {
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			return string(content), nil
+		},
+	}
+}
+
+// loadConfigFile reads path, runs it through a text/template pass (so a
+// single properties or network config file can be reused across
+// environments via the `env`/`file` functions, or caller-supplied lookup
+// functions such as a `vault` helper provided through
+// ProductConfig.TemplateFuncs), and parses the rendered result as YAML or
+// JSON into a generic map.
+//
+// Format is chosen by file extension (.yml/.yaml vs .json), falling back to
+// content sniffing for files with other extensions.
+func loadConfigFile(path string, templateFuncs map[string]interface{}) (map[string]interface{}, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := renderConfigTemplate(path, raw, templateFuncs)
+	if err != nil {
+		return nil, fmt.Errorf("could not render template %q: %s", path, err)
+	}
+
+	if isYAML(path, rendered) {
+		var contents map[string]interface{}
+		if err := yaml.Unmarshal(rendered, &contents); err != nil {
+			return nil, fmt.Errorf("could not parse YAML file %q: %s", path, err)
+		}
+		return normalizeYAML(contents), nil
+	}
+
+	var contents map[string]interface{}
+	if err := json.Unmarshal(rendered, &contents); err != nil {
+		return nil, fmt.Errorf("could not parse file %q: %s", path, err)
+	}
+	return contents, nil
+}
+
+func renderConfigTemplate(path string, raw []byte, templateFuncs map[string]interface{}) ([]byte, error) {
+	funcs := defaultTemplateFuncs()
+	for name, fn := range templateFuncs {
+		funcs[name] = fn
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Funcs(funcs).Parse(string(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isYAML decides whether contents should be parsed as YAML rather than
+// JSON: first by file extension, then by sniffing whether the rendered
+// contents look like a JSON object.
+func isYAML(path string, contents []byte) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return true
+	case ".json":
+		return false
+	}
+
+	trimmed := bytes.TrimSpace(contents)
+	return len(trimmed) == 0 || trimmed[0] != '{'
+}
+
+// normalizeYAML converts the map[interface{}]interface{} shape yaml.v2
+// produces for nested maps into map[string]interface{}, matching what
+// encoding/json returns, so downstream code (mergeProperties, property
+// validation) only has to handle one shape.
+func normalizeYAML(in map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(in))
+	for k, v := range in {
+		out[k] = normalizeYAMLValue(v)
+	}
+	return out
+}
+
+func normalizeYAMLValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			out[fmt.Sprintf("%v", key)] = normalizeYAMLValue(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = normalizeYAMLValue(val)
+		}
+		return out
+	default:
+		return v
+	}
+}
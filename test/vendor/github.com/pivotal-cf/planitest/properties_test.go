@@ -0,0 +1,138 @@
+package planitest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTempFileNamed writes contents to name inside a fresh temp dir and
+// returns its path, so tests can control the file extension loadConfigFile
+// dispatches on.
+func writeTempFileNamed(t *testing.T, name, contents string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "planitest-properties-test")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("could not write temp file: %s", err)
+	}
+	return path
+}
+
+func TestLoadConfigFileRoundTripsYAMLThroughMergeProperties(t *testing.T) {
+	path := writeTempFileNamed(t, "properties.yml", `
+.properties.some_property:
+  value: some-value
+.properties.nested:
+  value:
+    inner: inner-value
+`)
+
+	minimalProperties, err := loadConfigFile(path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	combined := mergeProperties(minimalProperties, map[string]interface{}{
+		".properties.additional": "additional-value",
+	})
+
+	some, ok := combined[".properties.some_property"].(map[string]interface{})
+	if !ok || some["value"] != "some-value" {
+		t.Fatalf("expected .properties.some_property to round-trip with value %q, got %+v", "some-value", combined[".properties.some_property"])
+	}
+
+	nested, ok := combined[".properties.nested"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected .properties.nested to be a map, got %+v", combined[".properties.nested"])
+	}
+	nestedValue, ok := nested["value"].(map[string]interface{})
+	if !ok || nestedValue["inner"] != "inner-value" {
+		t.Fatalf("expected nested YAML maps to normalize to map[string]interface{}, got %+v", nested["value"])
+	}
+
+	additional, ok := combined[".properties.additional"].(map[string]interface{})
+	if !ok || additional["value"] != "additional-value" {
+		t.Fatalf("expected additionalProperties to be wrapped as {value: ...}, got %+v", combined[".properties.additional"])
+	}
+}
+
+func TestIsYAMLUsesExtensionWhenPresent(t *testing.T) {
+	if !isYAML("properties.yml", []byte(`{"looks": "like json"}`)) {
+		t.Fatal("expected a .yml extension to always be treated as YAML, regardless of content")
+	}
+	if isYAML("properties.json", []byte("looks: like-yaml")) {
+		t.Fatal("expected a .json extension to always be treated as JSON, regardless of content")
+	}
+}
+
+func TestIsYAMLSniffsContentForExtensionlessFiles(t *testing.T) {
+	if isYAML("properties", []byte(`{"some_property": {"value": "some-value"}}`)) {
+		t.Fatal("expected JSON-object-looking content to be sniffed as JSON")
+	}
+	if !isYAML("properties", []byte("some_property:\n  value: some-value\n")) {
+		t.Fatal("expected non-JSON-object-looking content to be sniffed as YAML")
+	}
+}
+
+func TestLoadConfigFileSniffsJSONContentForExtensionlessFiles(t *testing.T) {
+	path := writeTempFileNamed(t, "properties", `{".properties.some_property": {"value": "some-value"}}`)
+
+	contents, err := loadConfigFile(path, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	some, ok := contents[".properties.some_property"].(map[string]interface{})
+	if !ok || some["value"] != "some-value" {
+		t.Fatalf("expected the extension-less file to parse as JSON, got %+v", contents)
+	}
+}
+
+func TestLoadConfigFileTemplateFuncsOverrideBuiltins(t *testing.T) {
+	path := writeTempFileNamed(t, "properties.yml", `
+.properties.some_property:
+  value: {{ env "PLANITEST_TEST_ENV_VAR" }}
+`)
+
+	os.Setenv("PLANITEST_TEST_ENV_VAR", "from-real-env")
+	t.Cleanup(func() { os.Unsetenv("PLANITEST_TEST_ENV_VAR") })
+
+	overriddenEnv := func(string) string { return "from-override" }
+
+	contents, err := loadConfigFile(path, map[string]interface{}{"env": overriddenEnv})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	some, ok := contents[".properties.some_property"].(map[string]interface{})
+	if !ok || some["value"] != "from-override" {
+		t.Fatalf("expected the caller-supplied env func to override the builtin, got %+v", contents)
+	}
+}
+
+func TestLoadConfigFileTemplateFuncsExtendBuiltins(t *testing.T) {
+	path := writeTempFileNamed(t, "properties.yml", `
+.properties.some_property:
+  value: {{ vault "some/path" }}
+`)
+
+	vaultFunc := func(string) string { return "from-vault" }
+
+	contents, err := loadConfigFile(path, map[string]interface{}{"vault": vaultFunc})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	some, ok := contents[".properties.some_property"].(map[string]interface{})
+	if !ok || some["value"] != "from-vault" {
+		t.Fatalf("expected the caller-supplied vault func to be available alongside the builtins, got %+v", contents)
+	}
+}
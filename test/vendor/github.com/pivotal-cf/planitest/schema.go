@@ -0,0 +1,210 @@
+package planitest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// propertySchema is the validator's normalized view of a single product
+// property, regardless of whether it came from the Ops Manager
+// /properties endpoint or a tile's metadata/*.yml file. Name is the full
+// dotted property reference (e.g. ".properties.some_property", or
+// ".properties.a_selector.an_option.a_child" for a selector's child) -
+// the same key `combined`/`mergeProperties` uses, not the bare blueprint
+// name from metadata.yml.
+type propertySchema struct {
+	Name     string
+	Type     string
+	Optional bool
+
+	// Options maps a selector's selected value to the child properties
+	// that are only required when that option is selected. Only populated
+	// for type "selector", and only ever known from a metadata file - the
+	// Ops Manager API returns selectors flattened, without their option
+	// trees.
+	Options map[string][]propertySchema
+}
+
+// tileMetadata is the subset of a tile's metadata/*.yml this package
+// understands, enough to validate the shape of a properties file before
+// configure-product is invoked.
+type tileMetadata struct {
+	PropertyBlueprints []tileProperty `yaml:"property_blueprints"`
+}
+
+type tileProperty struct {
+	Name            string       `yaml:"name"`
+	Type            string       `yaml:"type"`
+	Optional        bool         `yaml:"optional"`
+	Default         interface{}  `yaml:"default"`
+	OptionTemplates []tileOption `yaml:"option_templates"`
+}
+
+type tileOption struct {
+	Name               string         `yaml:"name"`
+	PropertyBlueprints []tileProperty `yaml:"property_blueprints"`
+}
+
+// loadSchemaFromMetadataFile parses a tile's metadata/*.yml file into the
+// property schema used to validate a properties file before it is sent to
+// Ops Manager.
+func loadSchemaFromMetadataFile(path string) ([]propertySchema, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata tileMetadata
+	if err := yaml.Unmarshal(raw, &metadata); err != nil {
+		return nil, fmt.Errorf("could not parse metadata file %q: %s", path, err)
+	}
+
+	return convertTileProperties(metadata.PropertyBlueprints, ".properties."), nil
+}
+
+// convertTileProperties builds propertySchemas with Name set to the full
+// dotted reference `om`/mergeProperties would use for each property:
+// prefix+p.Name for a top-level blueprint, and, recursively,
+// "<selector key>.<option name>."+child name for a selector's children.
+func convertTileProperties(properties []tileProperty, prefix string) []propertySchema {
+	out := make([]propertySchema, 0, len(properties))
+	for _, p := range properties {
+		key := prefix + p.Name
+		schema := propertySchema{
+			Name:     key,
+			Type:     p.Type,
+			Optional: p.Optional || p.Default != nil,
+		}
+
+		if len(p.OptionTemplates) > 0 {
+			schema.Options = make(map[string][]propertySchema, len(p.OptionTemplates))
+			for _, option := range p.OptionTemplates {
+				schema.Options[option.Name] = convertTileProperties(option.PropertyBlueprints, key+"."+option.Name+".")
+			}
+		}
+
+		out = append(out, schema)
+	}
+	return out
+}
+
+// loadSchemaFromAPIProperties converts the response of the Ops Manager
+// /api/v0/staged/products/:guid/properties endpoint into a property
+// schema.
+func loadSchemaFromAPIProperties(properties map[string]interface{}) []propertySchema {
+	out := make([]propertySchema, 0, len(properties))
+	for name, raw := range properties {
+		entry, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		schema := propertySchema{Name: name}
+		if t, ok := entry["type"].(string); ok {
+			schema.Type = t
+		}
+		if optional, ok := entry["optional"].(bool); ok {
+			schema.Optional = optional
+		}
+		out = append(out, schema)
+	}
+	return out
+}
+
+// validateProperties checks combined (the merged, `om`-shaped properties
+// map produced by mergeProperties) against schema, returning a single
+// error that aggregates every offending key, or nil if combined satisfies
+// schema.
+func validateProperties(combined map[string]interface{}, schema []propertySchema) error {
+	var problems []string
+	for _, s := range schema {
+		problems = append(problems, validateProperty(s, combined)...)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid properties:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func validateProperty(s propertySchema, combined map[string]interface{}) []string {
+	key := s.Name
+
+	entry, present := combined[key]
+	if !present {
+		if s.Optional {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: required property is missing", key)}
+	}
+
+	wrapper, ok := entry.(map[string]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("%s: expected {value: ...}, got %T", key, entry)}
+	}
+
+	value, hasValue := wrapper["value"]
+	if !hasValue {
+		return []string{fmt.Sprintf("%s: missing \"value\" key", key)}
+	}
+
+	var problems []string
+	if err := validatePropertyType(s.Type, value); err != nil {
+		problems = append(problems, fmt.Sprintf("%s: %s", key, err))
+	}
+
+	if s.Type == "selector" {
+		selected, _ := value.(string)
+		for optionName, children := range s.Options {
+			if optionName != selected {
+				continue
+			}
+			for _, child := range children {
+				problems = append(problems, validateProperty(child, combined)...)
+			}
+		}
+	}
+
+	return problems
+}
+
+// validatePropertyType checks value's Go shape against an Ops Manager
+// property type. Secret-shaped types (secret, rsa_cert_credentials, etc.)
+// must be wrapped as {value: {secret: ...}} or {value: {password: ...}}
+// rather than a plain scalar.
+func validatePropertyType(propType string, value interface{}) error {
+	switch propType {
+	case "", "string", "dropdown_select", "selector":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected string, got %T", value)
+		}
+	case "integer":
+		switch value.(type) {
+		case int, int64, float64:
+		default:
+			return fmt.Errorf("expected integer, got %T", value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected boolean, got %T", value)
+		}
+	case "collection":
+		if _, ok := value.([]interface{}); !ok {
+			return fmt.Errorf("expected a collection, got %T", value)
+		}
+	case "secret", "rsa_cert_credentials", "rsa_pkey_credentials", "salted_credentials", "simple_credentials":
+		secretValue, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected a secret value, got %T", value)
+		}
+		if _, ok := secretValue["secret"]; !ok {
+			if _, ok := secretValue["password"]; !ok {
+				return fmt.Errorf("expected a secret value wrapped as {secret: ...}, got %v", secretValue)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package planitest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMetadataYAML = `
+property_blueprints:
+- name: some_property
+  type: string
+- name: some_optional_property
+  type: string
+  optional: true
+- name: some_selector
+  type: selector
+  option_templates:
+  - name: option_one
+    property_blueprints:
+    - name: child_property
+      type: string
+  - name: option_two
+    property_blueprints:
+    - name: other_child_property
+      type: string
+- name: some_secret
+  type: secret
+`
+
+func writeTempFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "planitest-schema-test")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "metadata.yml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("could not write temp file: %s", err)
+	}
+	return path
+}
+
+func TestLoadSchemaFromMetadataFileMatchesCombinedPropertiesKeys(t *testing.T) {
+	path := writeTempFile(t, testMetadataYAML)
+
+	schema, err := loadSchemaFromMetadataFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	combined := map[string]interface{}{
+		".properties.some_property":                          map[string]interface{}{"value": "foo"},
+		".properties.some_selector":                           map[string]interface{}{"value": "option_one"},
+		".properties.some_selector.option_one.child_property": map[string]interface{}{"value": "bar"},
+		".properties.some_secret":                             map[string]interface{}{"value": map[string]interface{}{"secret": "shh"}},
+	}
+
+	if err := validateProperties(combined, schema); err != nil {
+		t.Fatalf("expected a real tile metadata file + matching properties to validate cleanly, got: %s", err)
+	}
+}
+
+func TestValidatePropertiesFlagsMissingRequiredProperty(t *testing.T) {
+	path := writeTempFile(t, testMetadataYAML)
+
+	schema, err := loadSchemaFromMetadataFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	combined := map[string]interface{}{
+		".properties.some_selector": map[string]interface{}{"value": "option_one"},
+		".properties.some_secret":   map[string]interface{}{"value": map[string]interface{}{"secret": "shh"}},
+	}
+
+	err = validateProperties(combined, schema)
+	if err == nil {
+		t.Fatal("expected an error for a missing required property, got nil")
+	}
+	if !strings.Contains(err.Error(), ".properties.some_property: required property is missing") {
+		t.Fatalf("expected error to name the missing dotted property reference, got: %s", err)
+	}
+}
+
+func TestValidatePropertiesOnlyRequiresSelectedOptionsChildren(t *testing.T) {
+	path := writeTempFile(t, testMetadataYAML)
+
+	schema, err := loadSchemaFromMetadataFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	combined := map[string]interface{}{
+		".properties.some_property": map[string]interface{}{"value": "foo"},
+		".properties.some_selector": map[string]interface{}{"value": "option_two"},
+		".properties.some_secret":   map[string]interface{}{"value": map[string]interface{}{"secret": "shh"}},
+		// option_two's child is required, option_one's is not since it
+		// wasn't selected.
+		".properties.some_selector.option_two.other_child_property": map[string]interface{}{"value": "baz"},
+	}
+
+	if err := validateProperties(combined, schema); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
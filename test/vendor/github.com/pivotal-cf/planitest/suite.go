@@ -0,0 +1,214 @@
+package planitest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ProductDependency declares that Product cannot be configured until
+// DependsOn has been configured.
+type ProductDependency struct {
+	Product   string
+	DependsOn string
+}
+
+// ProductSuite orchestrates configuring and rendering manifests for several
+// products as one foundation (e.g. p-bosh, then cf, then pas-windows)
+// rather than one tile at a time. Unlike ProductService.Configure, staged
+// changes are reverted once for the whole suite instead of once per
+// product, which is what makes composing several products possible.
+type ProductSuite struct {
+	products     map[string]*ProductService
+	order        []string
+	dependencies []ProductDependency
+}
+
+// NewProductSuite builds an empty ProductSuite. Add products with
+// AddProduct and dependency edges with AddDependency.
+func NewProductSuite() *ProductSuite {
+	return &ProductSuite{products: make(map[string]*ProductService)}
+}
+
+// AddProduct builds a ProductService for config and adds it to the suite.
+func (s *ProductSuite) AddProduct(config ProductConfig) error {
+	if _, exists := s.products[config.Name]; exists {
+		return fmt.Errorf("product %q already added to suite", config.Name)
+	}
+
+	service, err := NewProductService(config)
+	if err != nil {
+		return err
+	}
+
+	s.products[config.Name] = service
+	s.order = append(s.order, config.Name)
+	return nil
+}
+
+// AddProductWithBackend adds config to the suite backed by backend instead
+// of the HTTP client NewProductService builds, e.g. for tests or callers
+// still shelling out via an omBackend.
+func (s *ProductSuite) AddProductWithBackend(config ProductConfig, backend Backend) error {
+	if _, exists := s.products[config.Name]; exists {
+		return fmt.Errorf("product %q already added to suite", config.Name)
+	}
+
+	service, err := NewProductServiceWithBackend(config, backend)
+	if err != nil {
+		return err
+	}
+
+	s.products[config.Name] = service
+	s.order = append(s.order, config.Name)
+	return nil
+}
+
+// AddDependency declares that product cannot be configured until dependsOn
+// has been configured.
+func (s *ProductSuite) AddDependency(product, dependsOn string) {
+	s.dependencies = append(s.dependencies, ProductDependency{Product: product, DependsOn: dependsOn})
+}
+
+// Configure reverts any staged changes once, then stages and configures
+// every product in the suite in dependency order. additionalProperties is
+// keyed by product name, matching the argument ProductService.Configure
+// takes for a single product.
+func (s *ProductSuite) Configure(ctx context.Context, additionalProperties map[string]map[string]interface{}) error {
+	order, err := s.topologicalOrder()
+	if err != nil {
+		return err
+	}
+
+	if len(order) == 0 {
+		return nil
+	}
+
+	if err := s.products[order[0]].backend.RevertStagedChanges(); err != nil {
+		return err
+	}
+
+	for _, name := range order {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := s.products[name].configureWithoutRevert(additionalProperties[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type manifestResult struct {
+	name     string
+	manifest Manifest
+	err      error
+}
+
+// RenderManifests fans out RenderManifest across every product in the
+// suite, bounded to maxConcurrency concurrent calls (0 means unbounded),
+// and returns the rendered manifests keyed by product name.
+func (s *ProductSuite) RenderManifests(ctx context.Context, maxConcurrency int) (map[string]Manifest, error) {
+	if maxConcurrency <= 0 {
+		maxConcurrency = len(s.order)
+	}
+
+	results := make(chan manifestResult, len(s.order))
+	sem := make(chan struct{}, maxConcurrency)
+
+	var wg sync.WaitGroup
+	for _, name := range s.order {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results <- manifestResult{name: name, err: ctx.Err()}
+				return
+			}
+			defer func() { <-sem }()
+
+			manifest, err := s.products[name].RenderManifest()
+			results <- manifestResult{name: name, manifest: manifest, err: err}
+		}(name)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	manifests := make(map[string]Manifest, len(s.order))
+	var problems []string
+	for result := range results {
+		if result.err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", result.name, result.err))
+			continue
+		}
+		manifests[result.name] = result.manifest
+	}
+
+	if len(problems) > 0 {
+		return manifests, fmt.Errorf("unable to render manifests:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return manifests, nil
+}
+
+// topologicalOrder returns product names ordered so that every product
+// appears after everything it depends on, breaking ties by the order
+// products were added for determinism.
+func (s *ProductSuite) topologicalOrder() ([]string, error) {
+	dependsOn := make(map[string][]string, len(s.order))
+	for _, name := range s.order {
+		dependsOn[name] = nil
+	}
+	for _, dep := range s.dependencies {
+		if _, ok := s.products[dep.Product]; !ok {
+			return nil, fmt.Errorf("dependency declared for unknown product %q", dep.Product)
+		}
+		if _, ok := s.products[dep.DependsOn]; !ok {
+			return nil, fmt.Errorf("product %q depends on unknown product %q", dep.Product, dep.DependsOn)
+		}
+		dependsOn[dep.Product] = append(dependsOn[dep.Product], dep.DependsOn)
+	}
+
+	var order []string
+	visited := make(map[string]bool, len(s.order))
+	visiting := make(map[string]bool, len(s.order))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		if visited[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("dependency cycle detected at product %q", name)
+		}
+		visiting[name] = true
+
+		for _, dep := range dependsOn[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		visiting[name] = false
+		visited[name] = true
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range s.order {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
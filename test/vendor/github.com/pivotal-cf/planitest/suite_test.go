@@ -0,0 +1,236 @@
+package planitest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestSuite builds a ProductSuite with bare ProductService placeholders
+// for each name, bypassing AddProduct (and the env vars/network access
+// NewProductService needs), since topologicalOrder only cares about which
+// names and dependency edges exist.
+func newTestSuite(names ...string) *ProductSuite {
+	suite := NewProductSuite()
+	for _, name := range names {
+		suite.products[name] = &ProductService{config: ProductConfig{Name: name}}
+		suite.order = append(suite.order, name)
+	}
+	return suite
+}
+
+func TestTopologicalOrderRespectsDependencies(t *testing.T) {
+	suite := newTestSuite("p-bosh", "cf", "pas-windows")
+	suite.AddDependency("cf", "p-bosh")
+	suite.AddDependency("pas-windows", "cf")
+
+	order, err := suite.topologicalOrder()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	index := make(map[string]int, len(order))
+	for i, name := range order {
+		index[name] = i
+	}
+
+	if index["p-bosh"] >= index["cf"] {
+		t.Fatalf("expected p-bosh before cf, got order %v", order)
+	}
+	if index["cf"] >= index["pas-windows"] {
+		t.Fatalf("expected cf before pas-windows, got order %v", order)
+	}
+}
+
+func TestTopologicalOrderWithNoDependenciesKeepsInsertionOrder(t *testing.T) {
+	suite := newTestSuite("a", "b", "c")
+
+	order, err := suite.topologicalOrder()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{"a", "b", "c"}
+	for i, name := range expected {
+		if order[i] != name {
+			t.Fatalf("expected insertion order %v, got %v", expected, order)
+		}
+	}
+}
+
+func TestTopologicalOrderDetectsCycle(t *testing.T) {
+	suite := newTestSuite("a", "b", "c")
+	suite.AddDependency("a", "b")
+	suite.AddDependency("b", "c")
+	suite.AddDependency("c", "a")
+
+	_, err := suite.topologicalOrder()
+	if err == nil {
+		t.Fatal("expected a dependency cycle error, got nil")
+	}
+	if !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected error to mention the cycle, got: %s", err)
+	}
+}
+
+func TestTopologicalOrderRejectsUnknownDependency(t *testing.T) {
+	suite := newTestSuite("a")
+	suite.AddDependency("a", "does-not-exist")
+
+	_, err := suite.topologicalOrder()
+	if err == nil {
+		t.Fatal("expected an error for a dependency on an unknown product, got nil")
+	}
+}
+
+// fakeBackend is a hand-rolled Backend double: RevertStagedChanges and
+// StageProduct calls are recorded in shared slices (guarded by mu) so tests
+// can assert ordering and call counts across every product in a suite.
+type fakeBackend struct {
+	name string
+
+	mu             *sync.Mutex
+	revertCalls    *[]string
+	stageCalls     *[]string
+	stagedManifest string
+	renderErr      error
+}
+
+func (b *fakeBackend) RevertStagedChanges() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	*b.revertCalls = append(*b.revertCalls, b.name)
+	return nil
+}
+
+func (b *fakeBackend) StageProduct(name, version string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	*b.stageCalls = append(*b.stageCalls, name)
+	return nil
+}
+
+func (b *fakeBackend) ConfigureProduct(productName string, properties, network []byte) error {
+	return nil
+}
+
+func (b *fakeBackend) StagedManifest(productName string) (string, error) {
+	if b.renderErr != nil {
+		return "", b.renderErr
+	}
+	return b.stagedManifest, nil
+}
+
+func (b *fakeBackend) ProductProperties(productName string) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+// newFakeBackedSuite adds one product per name to suite, each against its
+// own fakeBackend sharing revertCalls/stageCalls so ordering can be
+// asserted across the whole suite, and returns the suite alongside those
+// shared slices.
+func newFakeBackedSuite(t *testing.T, names ...string) (*ProductSuite, *[]string, *[]string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "planitest-suite-test")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %s", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	propertiesFile := filepath.Join(dir, "properties.yml")
+	if err := ioutil.WriteFile(propertiesFile, []byte("{}"), 0644); err != nil {
+		t.Fatalf("could not write properties file: %s", err)
+	}
+	networkFile := filepath.Join(dir, "network.yml")
+	if err := ioutil.WriteFile(networkFile, []byte("{}"), 0644); err != nil {
+		t.Fatalf("could not write network file: %s", err)
+	}
+
+	mu := &sync.Mutex{}
+	revertCalls := &[]string{}
+	stageCalls := &[]string{}
+
+	suite := NewProductSuite()
+	for _, name := range names {
+		backend := &fakeBackend{
+			name:           name,
+			mu:             mu,
+			revertCalls:    revertCalls,
+			stageCalls:     stageCalls,
+			stagedManifest: fmt.Sprintf("name: %s\n", name),
+		}
+		config := ProductConfig{
+			Name:              name,
+			Version:           "1.0",
+			PropertiesFile:    propertiesFile,
+			NetworkConfigFile: networkFile,
+		}
+		if err := suite.AddProductWithBackend(config, backend); err != nil {
+			t.Fatalf("could not add product %q: %s", name, err)
+		}
+	}
+
+	return suite, revertCalls, stageCalls
+}
+
+func TestConfigureRevertsOnceAndStagesInDependencyOrder(t *testing.T) {
+	suite, revertCalls, stageCalls := newFakeBackedSuite(t, "p-bosh", "cf")
+	suite.AddDependency("cf", "p-bosh")
+
+	if err := suite.Configure(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(*revertCalls) != 1 {
+		t.Fatalf("expected RevertStagedChanges to be called exactly once for the whole suite, got %d calls: %v", len(*revertCalls), *revertCalls)
+	}
+
+	expected := []string{"p-bosh", "cf"}
+	if len(*stageCalls) != len(expected) {
+		t.Fatalf("expected stage calls %v, got %v", expected, *stageCalls)
+	}
+	for i, name := range expected {
+		if (*stageCalls)[i] != name {
+			t.Fatalf("expected products to be staged in dependency order %v, got %v", expected, *stageCalls)
+		}
+	}
+}
+
+func TestRenderManifestsAggregatesManifestsByName(t *testing.T) {
+	suite, _, _ := newFakeBackedSuite(t, "p-bosh", "cf")
+
+	manifests, err := suite.RenderManifests(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(manifests) != 2 {
+		t.Fatalf("expected a manifest per product, got %+v", manifests)
+	}
+	if _, ok := manifests["p-bosh"]; !ok {
+		t.Fatalf("expected a manifest for p-bosh, got %+v", manifests)
+	}
+	if _, ok := manifests["cf"]; !ok {
+		t.Fatalf("expected a manifest for cf, got %+v", manifests)
+	}
+}
+
+func TestRenderManifestsAggregatesErrorsAcrossProducts(t *testing.T) {
+	suite, _, _ := newFakeBackedSuite(t, "p-bosh", "cf")
+
+	suite.products["cf"].backend.(*fakeBackend).renderErr = fmt.Errorf("manifest endpoint returned 500")
+
+	_, err := suite.RenderManifests(context.Background(), 0)
+	if err == nil {
+		t.Fatal("expected an aggregated error when one product fails to render, got nil")
+	}
+	if !strings.Contains(err.Error(), "cf") || !strings.Contains(err.Error(), "manifest endpoint returned 500") {
+		t.Fatalf("expected the error to mention the failing product and its cause, got: %s", err)
+	}
+}